@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCompressionThreshold 是 -min-compress-size 的默认值：小文件压缩的开销
+// 往往比省下的带宽还大，不值得
+const defaultCompressionThreshold = 1024
+
+// compressionThreshold 由 -min-compress-size 配置，小于该大小的文件不压缩
+var compressionThreshold int64 = defaultCompressionThreshold
+
+// isCompressibleMIME 判断一个 MIME 类型是否值得压缩：文本类、JSON、JS、SVG 等，
+// 已经是压缩格式的二进制内容（图片、视频、zip 等）则不会从 gzip/br 中受益
+func isCompressibleMIME(mimeType string) bool {
+	base := mimeType
+	if idx := strings.IndexByte(base, ';'); idx >= 0 {
+		base = base[:idx]
+	}
+	base = strings.TrimSpace(base)
+	if strings.HasPrefix(base, "text/") {
+		return true
+	}
+	switch base {
+	case "application/json", "application/javascript", "application/x-javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// acceptsEncoding 判断 Accept-Encoding 头中是否列出了 token（如 "gzip"、"br"）且未被 q=0 显式拒绝
+func acceptsEncoding(acceptEncoding, token string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.SplitN(part, ";", 2)
+		name := strings.TrimSpace(fields[0])
+		if !strings.EqualFold(name, token) {
+			continue
+		}
+		if len(fields) == 2 && qValue(fields[1]) == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func qValue(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		p = strings.TrimSpace(p)
+		if v, ok := strings.CutPrefix(p, "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return 1
+}
+
+// openPrecompressed 尝试打开 reqPath 的预压缩兄弟文件（如 "a.js" -> "a.js.gz"），
+// 复用 FileSystem 抽象，因此 DirFS/MemFS/ZipFS 挂载的预压缩文件都能走这条快速路径
+func openPrecompressed(reqPath, suffix string) (File, bool) {
+	f, err := fileSystem.Open(reqPath + suffix)
+	if err != nil {
+		return nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
+
+// negotiateEncoding 根据 Accept-Encoding、MIME 类型和文件大小决定这次请求要不要、
+// 以及用哪种编码返回压缩内容。encoding 为空表示应当发送未压缩内容（调用方退回
+// serveFullContent）；encoding 非空而 pf 为 nil 表示要走实时 gzip（serveGzipChunked）；
+// pf 非空表示命中了磁盘/归档上的预压缩兄弟文件（servePrecompressed），调用方负责 Close 它。
+//
+// 本服务只使用 Go 标准库，没有引入第三方 brotli 编码器，因此不提供实时 brotli 压缩——
+// 只有当请求路径存在预生成的 .br 兄弟文件时才会以 br 编码响应；客户端只声明 br
+// 且没有这样的兄弟文件时，直接回退到未压缩响应，不会假装支持该编码
+func negotiateEncoding(req *HTTPRequest, mimeType, reqPath string, size int64) (encoding string, pf File) {
+	acceptEncoding := req.Headers["accept-encoding"]
+	if acceptEncoding == "" || !isCompressibleMIME(mimeType) || size < compressionThreshold {
+		return "", nil
+	}
+
+	if acceptsEncoding(acceptEncoding, "br") {
+		if f, ok := openPrecompressed(reqPath, ".br"); ok {
+			return "br", f
+		}
+	}
+
+	if acceptsEncoding(acceptEncoding, "gzip") {
+		if f, ok := openPrecompressed(reqPath, ".gz"); ok {
+			return "gzip", f
+		}
+		// 没有预压缩文件可用时，退而实时压缩
+		return "gzip", nil
+	}
+
+	return "", nil
+}
+
+// etagForEncoding 在选中了某种 Content-Encoding 时给 ETag 追加编码标记（做法类似
+// net/http 生态里常见的透明 gzip 中间件），使不同编码下的响应体拥有不同的 ETag。
+// 不这样做的话，客户端按 identity 请求缓存下 ETag X 对应的内容后，
+// 另一次以 gzip 协商、同样返回 etag X 的响应会被当成同一个缓存项的 304 命中，
+// 而实际响应体（是否压缩）并不相同
+func etagForEncoding(etag, encoding string) string {
+	if encoding == "" {
+		return etag
+	}
+	if strings.HasSuffix(etag, `"`) {
+		return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+	return etag + "-" + encoding
+}
+
+// servePrecompressed 原样返回一个已经在磁盘/归档上压缩好的兄弟文件，Content-Length 已知，无需分块
+func servePrecompressed(conn net.Conn, pf File, mimeType, encoding, etag string, modTime time.Time, keepAlive bool) error {
+	data, err := io.ReadAll(pf)
+	if err != nil {
+		resp := "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+		conn.Write([]byte(resp))
+		return err
+	}
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\nContent-Encoding: %s\r\nVary: Accept-Encoding\r\n",
+		len(data), mimeType, encoding)
+	header += fmt.Sprintf("Accept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n",
+		etag, formatHTTPDate(modTime), connStateHeaderValue(keepAlive))
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+// serveGzipChunked 把 src 的内容实时 gzip 压缩后以分块传输编码发送，
+// 因为压缩输出的总长度在写完之前无法得知，不能像其他响应那样预先给出 Content-Length。
+// 分块传输编码是 HTTP/1.1 的特性（RFC 7230 3.3.1），调用方必须确保客户端是 1.1；
+// HTTP/1.0 客户端应改走 serveGzipBuffered
+func serveGzipChunked(conn net.Conn, src io.Reader, mimeType, etag string, modTime time.Time, keepAlive bool) error {
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Encoding: gzip\r\nVary: Accept-Encoding\r\nTransfer-Encoding: chunked\r\n", mimeType)
+	header += fmt.Sprintf("Accept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n",
+		etag, formatHTTPDate(modTime), connStateHeaderValue(keepAlive))
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+
+	cw := newChunkedWriter(conn)
+	gz := gzip.NewWriter(cw)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// serveGzipBuffered 把 src 的内容实时 gzip 压缩到内存缓冲区后以固定 Content-Length 发送，
+// 供不支持分块传输编码的 HTTP/1.0 客户端使用
+func serveGzipBuffered(conn net.Conn, src io.Reader, mimeType, etag string, modTime time.Time, keepAlive bool) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\nContent-Encoding: gzip\r\nVary: Accept-Encoding\r\n",
+		buf.Len(), mimeType)
+	header += fmt.Sprintf("Accept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n",
+		etag, formatHTTPDate(modTime), connStateHeaderValue(keepAlive))
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+	_, err := conn.Write(buf.Bytes())
+	return err
+}
+
+// chunkedWriter 按 HTTP/1.1 分块传输编码（RFC 7230 4.1）给每次 Write 加上长度前缀，
+// 并在 Close 时写出结束块
+type chunkedWriter struct {
+	w io.Writer
+}
+
+func newChunkedWriter(w io.Writer) *chunkedWriter {
+	return &chunkedWriter{w: w}
+}
+
+func (c *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.w, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	if _, err := c.w.Write(p); err != nil {
+		return 0, err
+	}
+	if _, err := c.w.Write([]byte("\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *chunkedWriter) Close() error {
+	_, err := c.w.Write([]byte("0\r\n\r\n"))
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEtagForEncoding(t *testing.T) {
+	tests := []struct {
+		etag     string
+		encoding string
+		want     string
+	}{
+		{etag: `"abc"`, encoding: "", want: `"abc"`},
+		{etag: `"abc"`, encoding: "gzip", want: `"abc-gzip"`},
+		{etag: `W/"abc"`, encoding: "br", want: `W/"abc-br"`},
+	}
+	for _, tt := range tests {
+		if got := etagForEncoding(tt.etag, tt.encoding); got != tt.want {
+			t.Errorf("etagForEncoding(%q, %q) = %q; want %q", tt.etag, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+// TestNegotiateEncodingVariesETag 确认同一个资源在 identity 和 gzip 协商下
+// 会得到不同的 ETag，否则客户端可能把某种编码下缓存的响应体，误当成
+// 另一种编码请求的有效缓存命中
+func TestNegotiateEncodingVariesETag(t *testing.T) {
+	prevFS := fileSystem
+	fileSystem = NewMemFS(nil)
+	defer func() { fileSystem = prevFS }()
+
+	etag := `"abc"`
+
+	plainReq := &HTTPRequest{Headers: map[string]string{}}
+	encoding, pf := negotiateEncoding(plainReq, "text/plain", "/big.txt", 10000)
+	if encoding != "" || pf != nil {
+		t.Fatalf("没有 Accept-Encoding 时不应选择压缩，got encoding=%q pf=%v", encoding, pf)
+	}
+	if got := etagForEncoding(etag, encoding); got != etag {
+		t.Fatalf("identity 响应的 ETag 被意外修改: %q", got)
+	}
+
+	gzipReq := &HTTPRequest{Headers: map[string]string{"accept-encoding": "gzip"}}
+	encoding, pf = negotiateEncoding(gzipReq, "text/plain", "/big.txt", 10000)
+	if encoding != "gzip" || pf != nil {
+		t.Fatalf("应当选择实时 gzip，got encoding=%q pf=%v", encoding, pf)
+	}
+	if got := etagForEncoding(etag, encoding); got == etag {
+		t.Fatalf("gzip 响应应当有区别于 identity 的 ETag，got %q", got)
+	}
+}
+
+// TestServeGzipBufferedUsesContentLengthNotChunked 确认发给 HTTP/1.0 客户端的实时
+// gzip 响应使用固定 Content-Length 而不是分块传输编码，因为 HTTP/1.0 没有
+// chunked 这种传输编码（RFC 7230 3.3.1），客户端无法解析它
+func TestServeGzipBufferedUsesContentLengthNotChunked(t *testing.T) {
+	want := strings.Repeat("hello world ", 200)
+
+	serverConn, clientConn := net.Pipe()
+	go func() {
+		serveGzipBuffered(serverConn, strings.NewReader(want), "text/plain", `"etag"`, time.Now(), false)
+		serverConn.Close()
+	}()
+
+	status, headers, body := readResponse(t, bufio.NewReader(clientConn))
+	if status != 200 {
+		t.Fatalf("status = %d; want 200", status)
+	}
+	if _, ok := headers["transfer-encoding"]; ok {
+		t.Fatalf("HTTP/1.0 响应不应包含 Transfer-Encoding 头")
+	}
+	if _, ok := headers["content-length"]; !ok {
+		t.Fatalf("HTTP/1.0 响应必须带固定的 Content-Length")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("响应体不是合法的 gzip 数据: %v", err)
+	}
+	got, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("解压响应体失败: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("解压后内容 = %q; want %q", got, want)
+	}
+}
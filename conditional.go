@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// httpTimeFormat 是 HTTP 头部中日期字段使用的格式（RFC 7231 imf-fixdate）
+const httpTimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// smallFileHashThreshold 以下大小的文件按内容计算强 ETag，更大的文件按 (size, mtime) 计算弱 ETag，
+// 避免每次请求都要把一个大文件整个读入内存去做哈希
+const smallFileHashThreshold = 8 * 1024
+
+func formatHTTPDate(t time.Time) string {
+	return t.UTC().Format(httpTimeFormat)
+}
+
+func parseHTTPDate(s string) (time.Time, error) {
+	return time.Parse(httpTimeFormat, s)
+}
+
+// computeETag 为一个文件计算 ETag：体积不超过 smallFileHashThreshold 时
+// 用内容的 SHA-256 摘要生成强 ETag，否则退化为基于 (size, mtime) 的弱 ETag
+func computeETag(info FileInfo, ra io.ReaderAt) string {
+	if ra != nil && info.Size() > 0 && info.Size() <= smallFileHashThreshold {
+		buf := make([]byte, info.Size())
+		if _, err := ra.ReadAt(buf, 0); err == nil || err == io.EOF {
+			sum := sha256.Sum256(buf)
+			return fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:]))
+		}
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// etagMatches 判断 header（形如 If-None-Match 的逗号分隔列表，或 "*"）中
+// 是否有一项与 etag 匹配；比较时忽略 W/ 弱校验前缀
+func etagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+	strong := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == strong {
+			return true
+		}
+	}
+	return false
+}
+
+// errPreconditionFailed 表示 If-Match / If-Unmodified-Since 未满足，调用方应回复 412
+var errPreconditionFailed = errors.New("precondition failed")
+
+// checkPreconditions 依次校验 If-Match 和 If-Unmodified-Since（RFC 7232 优先级中
+// 排在 If-None-Match/If-Modified-Since 之前，且两者都不满足时必须返回 412 而不是
+// 按后两者继续协商），再交给 notModified 判断能否短路为 304
+func checkPreconditions(req *HTTPRequest, etag string, modTime time.Time) (notMod bool, err error) {
+	if im, ok := req.Headers["if-match"]; ok && !etagMatches(im, etag) {
+		return false, errPreconditionFailed
+	}
+	if ius, ok := req.Headers["if-unmodified-since"]; ok {
+		if t, err := parseHTTPDate(ius); err == nil && modTime.Truncate(time.Second).After(t) {
+			return false, errPreconditionFailed
+		}
+	}
+	return notModified(req, etag, modTime), nil
+}
+
+// notModified 判断能否依据 If-None-Match / If-Modified-Since 短路为 304。
+// 优先级遵循 RFC 7232：存在 If-None-Match 时忽略 If-Modified-Since
+func notModified(req *HTTPRequest, etag string, modTime time.Time) bool {
+	if inm, ok := req.Headers["if-none-match"]; ok {
+		return etagMatches(inm, etag)
+	}
+	if ims, ok := req.Headers["if-modified-since"]; ok {
+		if t, err := parseHTTPDate(ims); err == nil {
+			return !modTime.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// strongETagMatches 判断 candidate 是否与 etag 构成强比较意义上的相等（RFC 7232 2.3.2）：
+// 只要任意一方带 W/ 弱校验前缀就不算相等，哪怕去掉前缀后的内容一致。
+// If-Range（RFC 7233 3.2）明确要求强比较——弱校验器只能证明两个表示语义等价，
+// 不能证明字节级完全相同，而分段 Range 响应的正确性恰恰依赖于各个分段
+// 确实来自同一个字节序列，用弱 ETag 放行就可能把不同版本的内容拼接在一起
+func strongETagMatches(candidate, etag string) bool {
+	candidate = strings.TrimSpace(candidate)
+	if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	return candidate == etag
+}
+
+// ifRangeSatisfied 判断 handleRangeRequest 是否应当继续按 Range 处理。
+// If-Range 的取值既可以是一个 HTTP 日期也可以是一个 ETag；未设置该头时总是满足。
+// 按 ETag 比较时必须用强比较，弱 ETag 一律视为不满足，迫使服务端退回完整内容
+func ifRangeSatisfied(req *HTTPRequest, etag string, modTime time.Time) bool {
+	v, ok := req.Headers["if-range"]
+	if !ok {
+		return true
+	}
+	if t, err := parseHTTPDate(v); err == nil {
+		return !modTime.Truncate(time.Second).After(t)
+	}
+	return strongETagMatches(v, etag)
+}
+
+// respondIfNotModified 校验全部条件请求头（If-Match、If-Unmodified-Since、
+// If-None-Match、If-Modified-Since，按 RFC 7232 优先级），在能够短路时直接发送
+// 412 或 304 并返回 handled=true，供 HEAD、Range、普通 GET（含压缩协商）等
+// 各个响应路径在决定具体发什么内容之前共用
+func respondIfNotModified(conn net.Conn, req *HTTPRequest, etag string, modTime time.Time, keepAlive bool) (handled bool, err error) {
+	notMod, err := checkPreconditions(req, etag, modTime)
+	if errors.Is(err, errPreconditionFailed) {
+		return true, servePreconditionFailed(conn, keepAlive)
+	}
+	if !notMod {
+		return false, nil
+	}
+	return true, serve304(conn, etag, modTime, keepAlive)
+}
+
+// serve304 响应 304 Not Modified：无响应体，仍需带上 ETag/Last-Modified/Date
+func serve304(conn net.Conn, etag string, modTime time.Time, keepAlive bool) error {
+	header := fmt.Sprintf("HTTP/1.1 304 Not Modified\r\nETag: %s\r\nLast-Modified: %s\r\nDate: %s\r\nContent-Length: 0\r\nConnection: %s\r\n\r\n",
+		etag, formatHTTPDate(modTime), formatHTTPDate(time.Now()), connStateHeaderValue(keepAlive))
+	_, err := conn.Write([]byte(header))
+	return err
+}
+
+// servePreconditionFailed 响应 412 Precondition Failed：If-Match 或
+// If-Unmodified-Since 未满足，资源状态与客户端预期不符
+func servePreconditionFailed(conn net.Conn, keepAlive bool) error {
+	header := fmt.Sprintf("HTTP/1.1 412 Precondition Failed\r\nContent-Length: 0\r\nConnection: %s\r\n\r\n",
+		connStateHeaderValue(keepAlive))
+	_, err := conn.Write([]byte(header))
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	etag := `"abc"`
+	modTime := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := formatHTTPDate(modTime.Add(-time.Hour))
+	after := formatHTTPDate(modTime.Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantNotMod bool
+		wantErr    error
+	}{
+		{
+			name:       "if-match satisfied falls through to no caching headers",
+			headers:    map[string]string{"if-match": etag},
+			wantNotMod: false,
+		},
+		{
+			name:    "if-match mismatch is a precondition failure",
+			headers: map[string]string{"if-match": `"other"`},
+			wantErr: errPreconditionFailed,
+		},
+		{
+			name:       "if-unmodified-since satisfied",
+			headers:    map[string]string{"if-unmodified-since": after},
+			wantNotMod: false,
+		},
+		{
+			name:    "if-unmodified-since violated is a precondition failure",
+			headers: map[string]string{"if-unmodified-since": before},
+			wantErr: errPreconditionFailed,
+		},
+		{
+			name:       "if-none-match still honored when no if-match present",
+			headers:    map[string]string{"if-none-match": etag},
+			wantNotMod: true,
+		},
+		{
+			name: "if-match takes precedence over if-none-match",
+			headers: map[string]string{
+				"if-match":      `"other"`,
+				"if-none-match": etag,
+			},
+			wantErr: errPreconditionFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &HTTPRequest{Headers: tt.headers}
+			notMod, err := checkPreconditions(req, etag, modTime)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if notMod != tt.wantNotMod {
+				t.Fatalf("notMod = %v; want %v", notMod, tt.wantNotMod)
+			}
+		})
+	}
+}
+
+// TestIfRangeSatisfied 确认 If-Range 按 RFC 7233 3.2 使用强比较：
+// 弱 ETag 即便去除 W/ 前缀后与当前资源一致，也必须视为不满足，迫使回退到完整响应
+func TestIfRangeSatisfied(t *testing.T) {
+	modTime := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		header  string
+		etag    string
+		modTime time.Time
+		want    bool
+	}{
+		{
+			name: "no if-range header always satisfied",
+			want: true,
+		},
+		{
+			name:   "matching strong etag satisfies",
+			header: `"abc"`,
+			etag:   `"abc"`,
+			want:   true,
+		},
+		{
+			name:   "mismatched strong etag does not satisfy",
+			header: `"abc"`,
+			etag:   `"xyz"`,
+			want:   false,
+		},
+		{
+			name:   "weak etag on the wire never satisfies even if identical",
+			header: `W/"abc"`,
+			etag:   `W/"abc"`,
+			want:   false,
+		},
+		{
+			name:   "weak resource etag never satisfies a strong-looking header value",
+			header: `"abc"`,
+			etag:   `W/"abc"`,
+			want:   false,
+		},
+		{
+			name:    "http-date if-range still compared by modification time",
+			header:  formatHTTPDate(modTime),
+			modTime: modTime,
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.header != "" {
+				headers["if-range"] = tt.header
+			}
+			req := &HTTPRequest{Headers: headers}
+			got := ifRangeSatisfied(req, tt.etag, tt.modTime)
+			if got != tt.want {
+				t.Fatalf("ifRangeSatisfied = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
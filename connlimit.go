@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// connLimiter 按客户端 IP 限制并发连接数，防止单个来源用大量并发分段下载
+// 请求占满服务器的连接资源。max<=0 表示不限制
+type connLimiter struct {
+	max int
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{max: max, counts: make(map[string]int)}
+}
+
+// acquire 尝试为 ip 占用一个连接名额，返回是否成功
+func (l *connLimiter) acquire(ip string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] >= l.max {
+		return false
+	}
+	l.counts[ip]++
+	return true
+}
+
+// release 归还一个连接名额
+func (l *connLimiter) release(ip string) {
+	if l.max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[ip]--
+	if l.counts[ip] <= 0 {
+		delete(l.counts, ip)
+	}
+}
+
+// remoteIP 从连接的远端地址中提取不带端口的主机部分
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
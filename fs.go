@@ -0,0 +1,625 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileInfo 描述一个文件或目录的基本元数据，是 os.FileInfo 的一个子集，
+// 因此 os.FileInfo 值可以直接当作 FileInfo 使用
+type FileInfo interface {
+	Name() string
+	Size() int64
+	ModTime() time.Time
+	IsDir() bool
+}
+
+// File 是 FileSystem.Open 返回的句柄。普通文件支持读取和定位，
+// 目录句柄支持 Readdir 罗列子项；对目录调用 Read/Seek 或对文件调用 Readdir 均返回错误
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+	Stat() (FileInfo, error)
+	Readdir() ([]FileInfo, error)
+}
+
+// FileSystem 是处理器解析请求路径所依赖的抽象根，
+// 使 getFile/generateDirectoryPage 不必直接触碰 os 包，
+// 从而可以挂载磁盘目录、内存数据或 zip 归档，并支持脱离磁盘的单元测试
+type FileSystem interface {
+	Open(name string) (File, error)
+}
+
+// WriteFS 是 FileSystem 的一个可选扩展，由支持写入的后端（目前只有 DirFS）实现，
+// PUT/POST 上传处理器据此判断是否能够接受写入以及目标路径是否已存在
+type WriteFS interface {
+	FileSystem
+	// Create 以 name 为目标路径创建一个可写句柄；实现应当原子地完成写入
+	// （例如先写临时文件再 rename），避免并发请求或写入中途失败时看到半截文件
+	Create(name string) (io.WriteCloser, error)
+	// Exists 报告 name 对应的路径当前是否已经存在
+	Exists(name string) bool
+}
+
+// maxHandlesPerPath 限制单个路径可缓存的空闲句柄数，多余的直接关闭而不是无限堆积
+const maxHandlesPerPath = 4
+
+// maxPooledPaths 限制 DirFS 同时跟踪的不同路径数，超出时淘汰一个旧条目，
+// 防止长期运行、访问过大量不同文件之后 pools 这个 map 本身无界增长、句柄无限泄漏
+const maxPooledPaths = 1024
+
+// filePool 是某个已解析路径的可复用 *os.File 集合
+type filePool struct {
+	mu      sync.Mutex
+	handles []*os.File
+}
+
+func (p *filePool) get() *os.File {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.handles)
+	if n == 0 {
+		return nil
+	}
+	f := p.handles[n-1]
+	p.handles = p.handles[:n-1]
+	return f
+}
+
+func (p *filePool) put(f *os.File) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.handles) >= maxHandlesPerPath {
+		f.Close()
+		return
+	}
+	p.handles = append(p.handles, f)
+}
+
+// closeAll 关闭池中所有空闲句柄并清空，用于路径失效时清理
+func (p *filePool) closeAll() {
+	p.mu.Lock()
+	handles := p.handles
+	p.handles = nil
+	p.mu.Unlock()
+	for _, f := range handles {
+		f.Close()
+	}
+}
+
+// DirFS 将磁盘上的某个目录作为服务器根目录暴露出去。
+// 任何清理后仍然落在根目录之外的路径（包含 ".."、NUL 字节，
+// 或者通过符号链接逃逸）都会被拒绝。
+// 为避免同一个大文件被大量并发 Range 请求反复打开耗尽文件描述符，
+// 每个已解析路径都维护一个有上限的 *os.File 池，Close 时归还而不是真正关闭；
+// Create 原子替换文件内容后会使该路径的池失效，防止后续 Open 命中指向旧 inode 的陈旧句柄
+type DirFS struct {
+	root string
+
+	mu    sync.Mutex
+	pools map[string]*filePool
+}
+
+// NewDirFS 以 root 作为根目录构造一个 DirFS
+func NewDirFS(root string) *DirFS {
+	return &DirFS{root: root, pools: make(map[string]*filePool)}
+}
+
+func (fsys *DirFS) poolFor(path string) *filePool {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	pool, ok := fsys.pools[path]
+	if ok {
+		return pool
+	}
+	if len(fsys.pools) >= maxPooledPaths {
+		fsys.evictOneLocked()
+	}
+	pool = &filePool{}
+	fsys.pools[path] = pool
+	return pool
+}
+
+// evictOneLocked 关闭并移除 pools 中的任意一个条目（调用方必须已持有 fsys.mu），
+// 为新路径腾出名额；Go 的 map 迭代顺序本就是随机的，这里依赖它做一个简单的近似淘汰
+func (fsys *DirFS) evictOneLocked() {
+	for path, pool := range fsys.pools {
+		delete(fsys.pools, path)
+		pool.closeAll()
+		return
+	}
+}
+
+// invalidate 关闭并丢弃 path 对应池中所有已缓存的句柄。
+// Create 原子 rename 替换文件之后必须调用它，否则池里残留的旧句柄仍指向被替换前的 inode，
+// 后续 Open 复用到它就会返回过期的内容和大小
+func (fsys *DirFS) invalidate(path string) {
+	fsys.mu.Lock()
+	pool, ok := fsys.pools[path]
+	if ok {
+		delete(fsys.pools, path)
+	}
+	fsys.mu.Unlock()
+	if ok {
+		pool.closeAll()
+	}
+}
+
+// popPooled 取出一个可复用的、已定位到文件开头的句柄；若没有可用句柄则返回 nil
+func (fsys *DirFS) popPooled(path string) *os.File {
+	fsys.mu.Lock()
+	pool, ok := fsys.pools[path]
+	fsys.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	f := pool.get()
+	if f == nil {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil
+	}
+	return f
+}
+
+func (fsys *DirFS) resolve(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("路径包含非法字符: %q", name)
+	}
+	// 按 URL 风格清理（总是以 "/" 为根），避免 "../" 越权后再映射到磁盘路径
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	full := filepath.Join(fsys.root, filepath.FromSlash(cleaned))
+
+	resolvedRoot, err := filepath.EvalSymlinks(fsys.root)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// 目标本身不存在是正常情况（例如即将创建的文件），只需校验其父目录未越权
+		parent, parentErr := filepath.EvalSymlinks(filepath.Dir(full))
+		if parentErr != nil {
+			return "", parentErr
+		}
+		if !withinRoot(parent, resolvedRoot) {
+			return "", fmt.Errorf("路径越权: %q", name)
+		}
+		return full, nil
+	}
+
+	if !withinRoot(resolved, resolvedRoot) {
+		return "", fmt.Errorf("路径越权: %q", name)
+	}
+	return full, nil
+}
+
+func withinRoot(p, root string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (!strings.HasPrefix(rel, "..") && !filepath.IsAbs(rel))
+}
+
+// Open 实现 FileSystem
+func (fsys *DirFS) Open(name string) (File, error) {
+	full, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if f := fsys.popPooled(full); f != nil {
+		return &dirFile{f: f, fsys: fsys, path: full, pooled: true}, nil
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// 目录句柄不进池：ReadDir 的读取位置语义不适合像普通文件那样回绕复用
+	return &dirFile{f: f, fsys: fsys, path: full, pooled: !fi.IsDir()}, nil
+}
+
+type dirFile struct {
+	f      *os.File
+	fsys   *DirFS
+	path   string
+	pooled bool // 为 true 时 Close 将句柄归还到 fsys 的池中而不是真正关闭
+}
+
+func (d *dirFile) Read(p []byte) (int, error)                   { return d.f.Read(p) }
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) { return d.f.Seek(offset, whence) }
+func (d *dirFile) ReadAt(p []byte, off int64) (int, error)      { return d.f.ReadAt(p, off) }
+
+func (d *dirFile) Close() error {
+	if !d.pooled {
+		return d.f.Close()
+	}
+	d.fsys.poolFor(d.path).put(d.f)
+	return nil
+}
+
+// osFile 实现 fileDescriptorProvider，供 range.go 在可行时走零拷贝 sendfile 路径
+func (d *dirFile) osFile() *os.File {
+	return d.f
+}
+
+// Exists 实现 WriteFS
+func (fsys *DirFS) Exists(name string) bool {
+	full, err := fsys.resolve(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(full)
+	return err == nil
+}
+
+// Create 实现 WriteFS：写入一个与目标同目录下的临时文件，Close 时原子 rename 到位，
+// 避免并发读取者或写入失败时看到半截文件
+func (fsys *DirFS) Create(name string) (io.WriteCloser, error) {
+	full, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(full)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{tmp: tmp, final: full, fsys: fsys}, nil
+}
+
+// atomicFile 把内容写入一个临时文件，只有在 Close 成功完成写入后才 rename 到最终路径，
+// 任何一步出错都会清理掉临时文件，不留下半截内容。rename 成功后还会使 final 路径的
+// 句柄池失效，否则池里缓存的旧句柄仍指向被替换前的 inode，后续 Open 会复用到陈旧内容
+type atomicFile struct {
+	tmp   *os.File
+	final string
+	fsys  *DirFS
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	return a.tmp.Write(p)
+}
+
+func (a *atomicFile) Close() error {
+	if err := a.tmp.Close(); err != nil {
+		os.Remove(a.tmp.Name())
+		return err
+	}
+	if err := os.Rename(a.tmp.Name(), a.final); err != nil {
+		os.Remove(a.tmp.Name())
+		return err
+	}
+	a.fsys.invalidate(a.final)
+	return nil
+}
+
+func (d *dirFile) Stat() (FileInfo, error) {
+	return d.f.Stat()
+}
+
+func (d *dirFile) Readdir() ([]FileInfo, error) {
+	entries, err := d.f.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// memFileInfo 是一个与具体数据源无关的 FileInfo 实现，MemFS 和 ZipFS 共用
+type memFileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return i.mtime }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+
+// memFile 是驻留在内存中的只读文件句柄，MemFS 和 ZipFS（读取条目后）共用
+type memFile struct {
+	name  string
+	data  []byte
+	mtime time.Time
+	*bytes.Reader
+}
+
+func newMemFile(name string, data []byte, mtime time.Time) *memFile {
+	return &memFile{name: name, data: data, mtime: mtime, Reader: bytes.NewReader(data)}
+}
+
+func (f *memFile) Close() error { return nil }
+
+func (f *memFile) Stat() (FileInfo, error) {
+	return memFileInfo{name: f.name, size: int64(len(f.data)), mtime: f.mtime}, nil
+}
+
+func (f *memFile) Readdir() ([]FileInfo, error) {
+	return nil, fmt.Errorf("%s 不是目录", f.name)
+}
+
+// MemFS 是完全基于内存 map 构建的文件系统，主要用于测试和内嵌静态资源，不产生任何磁盘 I/O。
+// map 的键是以 "/" 分隔的相对路径（如 "css/site.css"），目录由共享前缀隐式推导得出
+type MemFS struct {
+	files map[string][]byte
+	mtime time.Time
+}
+
+// NewMemFS 以 files 构造一个 MemFS，mtime 统一用于所有条目
+func NewMemFS(files map[string][]byte) *MemFS {
+	return &MemFS{files: files, mtime: time.Now()}
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "." {
+		clean = ""
+	}
+	if data, ok := m.files[clean]; ok {
+		return newMemFile(path.Base(clean), data, m.mtime), nil
+	}
+
+	sizes := make(map[string]int64, len(m.files))
+	for k, v := range m.files {
+		sizes[k] = int64(len(v))
+	}
+	children, ok := directChildren(clean, sizes)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &memDirFile{entries: children, dir: clean, mtime: m.mtime}, nil
+}
+
+// dirEntry 是虚拟目录中一个直接子项的名称、大小和类型
+type dirEntry struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+// directChildren 在一组扁平的完整路径（path -> 文件大小）中，
+// 找出 dir 目录下的所有直接子项，自动去重并推导出中间目录。
+// ok 为 false 表示 dir 本身不存在（没有任何条目以它为前缀）
+func directChildren(dir string, sizes map[string]int64) ([]dirEntry, bool) {
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+	seen := make(map[string]bool)
+	var entries []dirEntry
+	found := dir == ""
+	for fullName, size := range sizes {
+		if !strings.HasPrefix(fullName, prefix) {
+			continue
+		}
+		found = true
+		rest := strings.TrimPrefix(fullName, prefix)
+		if rest == "" {
+			continue
+		}
+		child := rest
+		isDir := false
+		if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+			child = rest[:idx]
+			isDir = true
+			size = 0
+		}
+		if !seen[child] {
+			seen[child] = true
+			entries = append(entries, dirEntry{name: child, size: size, isDir: isDir})
+		}
+	}
+	return entries, found
+}
+
+// memDirFile 罗列内存/zip 文件系统中某个虚拟目录的直接子项
+type memDirFile struct {
+	entries []dirEntry
+	dir     string
+	mtime   time.Time
+}
+
+func (d *memDirFile) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s 是一个目录", d.dir)
+}
+
+func (d *memDirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, fmt.Errorf("%s 是一个目录", d.dir)
+}
+
+func (d *memDirFile) Close() error { return nil }
+
+func (d *memDirFile) Stat() (FileInfo, error) {
+	name := path.Base(d.dir)
+	if d.dir == "" {
+		name = "/"
+	}
+	return memFileInfo{name: name, mtime: d.mtime, dir: true}, nil
+}
+
+func (d *memDirFile) Readdir() ([]FileInfo, error) {
+	infos := make([]FileInfo, len(d.entries))
+	for i, e := range d.entries {
+		infos[i] = memFileInfo{name: e.name, size: e.size, mtime: d.mtime, dir: e.isDir}
+	}
+	return infos, nil
+}
+
+// ZipFS 透明地从一个 zip 归档中提供文件，归档内的每个条目都会成为一个虚拟路径。
+// 条目在打开时整体读入内存，归档体量应当适合常驻内存（与 MemFS 的定位一致）
+type ZipFS struct {
+	byName map[string]*zip.File
+	closer io.Closer // 仅当归档由 OpenZipFS 独占打开时非 nil
+}
+
+// NewZipFS 以一个已打开的 zip.Reader 构造 ZipFS，调用方负责其生命周期
+func NewZipFS(zr *zip.Reader) *ZipFS {
+	fsys := &ZipFS{byName: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		fsys.byName[strings.TrimSuffix(f.Name, "/")] = f
+	}
+	return fsys
+}
+
+// OpenZipFS 从磁盘上的一个 .zip 文件构造 ZipFS，Close 时一并关闭归档
+func OpenZipFS(archivePath string) (*ZipFS, error) {
+	rc, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	fsys := NewZipFS(&rc.Reader)
+	fsys.closer = rc
+	return fsys, nil
+}
+
+// Close 关闭底层归档文件（如果是本 ZipFS 独占打开的）
+func (z *ZipFS) Close() error {
+	if z.closer != nil {
+		return z.closer.Close()
+	}
+	return nil
+}
+
+// mountEntry 绑定一个 URL 前缀与挂载在该前缀下的文件系统
+type mountEntry struct {
+	prefix string
+	fs     FileSystem
+}
+
+// MountFS 按 URL 前缀把多个 FileSystem 聚合成一个：这是 DirFS/MemFS/ZipFS
+// 在运行中的服务器上真正可达的唯一途径（见 main 的 -mount 标志）。
+// 匹配按前缀长度从长到短依次尝试，因此更具体的挂载点优先于 "/" 兜底
+type MountFS struct {
+	mounts []mountEntry
+}
+
+// NewMountFS 以 mounts（URL 前缀 -> 文件系统）构造一个 MountFS，调用方必须
+// 挂载一个 "/" 前缀作为兜底
+func NewMountFS(mounts map[string]FileSystem) *MountFS {
+	entries := make([]mountEntry, 0, len(mounts))
+	for prefix, fs := range mounts {
+		entries = append(entries, mountEntry{prefix: prefix, fs: fs})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return len(entries[i].prefix) > len(entries[j].prefix)
+	})
+	return &MountFS{mounts: entries}
+}
+
+// resolve 返回 name 命中的最长前缀挂载，以及去掉该前缀后、要转交给它的子路径
+func (m *MountFS) resolve(name string) (FileSystem, string) {
+	clean := path.Clean("/" + name)
+	for _, e := range m.mounts {
+		if e.prefix == clean {
+			return e.fs, "/"
+		}
+		if e.prefix != "/" && strings.HasPrefix(clean, e.prefix+"/") {
+			return e.fs, strings.TrimPrefix(clean, e.prefix)
+		}
+	}
+	for _, e := range m.mounts {
+		if e.prefix == "/" {
+			return e.fs, clean
+		}
+	}
+	return nil, ""
+}
+
+// Open 实现 FileSystem
+func (m *MountFS) Open(name string) (File, error) {
+	fs, sub := m.resolve(name)
+	if fs == nil {
+		return nil, os.ErrNotExist
+	}
+	return fs.Open(sub)
+}
+
+// Create 实现 WriteFS：只有命中的挂载点自身支持写入时才能创建，
+// 例如挂载在某前缀下的只读 ZipFS 会在此处报错
+func (m *MountFS) Create(name string) (io.WriteCloser, error) {
+	fs, sub := m.resolve(name)
+	wfs, ok := fs.(WriteFS)
+	if !ok {
+		return nil, fmt.Errorf("路径 %q 所在的挂载点不支持写入", name)
+	}
+	return wfs.Create(sub)
+}
+
+// Exists 实现 WriteFS
+func (m *MountFS) Exists(name string) bool {
+	fs, sub := m.resolve(name)
+	wfs, ok := fs.(WriteFS)
+	if !ok {
+		return false
+	}
+	return wfs.Exists(sub)
+}
+
+func (z *ZipFS) Open(name string) (File, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "." {
+		clean = ""
+	}
+	if clean != "" {
+		if f, ok := z.byName[clean]; ok && !f.FileInfo().IsDir() {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			return newMemFile(path.Base(clean), data, f.Modified), nil
+		}
+	}
+
+	sizes := make(map[string]int64, len(z.byName))
+	for entryName, f := range z.byName {
+		if !f.FileInfo().IsDir() {
+			sizes[entryName] = f.FileInfo().Size()
+		}
+	}
+	children, ok := directChildren(clean, sizes)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &memDirFile{entries: children, dir: clean, mtime: time.Now()}, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestDirFSCreateInvalidatesPool 重现复查中指出的 bug：PUT/Create 原子替换文件之后，
+// 一个命中句柄池的 GET 不应该再看到替换前的旧内容
+func TestDirFSCreateInvalidatesPool(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatalf("准备测试文件失败: %v", err)
+	}
+
+	fsys := NewDirFS(dir)
+
+	f1, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatalf("第一次 Open 失败: %v", err)
+	}
+	data, err := io.ReadAll(f1)
+	if err != nil || string(data) != "old" {
+		t.Fatalf("读到 %q, %v; want %q", data, err, "old")
+	}
+	// Close 把这个常规文件句柄归还到池中，而不是真正关闭
+	if err := f1.Close(); err != nil {
+		t.Fatalf("Close 失败: %v", err)
+	}
+
+	w, err := fsys.Create("a.txt")
+	if err != nil {
+		t.Fatalf("Create 失败: %v", err)
+	}
+	if _, err := w.Write([]byte("new content")); err != nil {
+		t.Fatalf("Write 失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(Create) 失败: %v", err)
+	}
+
+	f2, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatalf("第二次 Open 失败: %v", err)
+	}
+	defer f2.Close()
+	data, err = io.ReadAll(f2)
+	if err != nil || string(data) != "new content" {
+		t.Fatalf("Create 之后读到 %q, %v; want %q (池中不应残留旧句柄)", data, err, "new content")
+	}
+}
+
+// TestFilePoolBoundsHandleCount 确认单路径的空闲句柄数有上限，多余的直接关闭而不是无限堆积
+func TestFilePoolBoundsHandleCount(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatalf("准备测试文件失败: %v", err)
+	}
+
+	pool := &filePool{}
+	for i := 0; i < maxHandlesPerPath+2; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open 失败: %v", err)
+		}
+		pool.put(f)
+	}
+	if len(pool.handles) != maxHandlesPerPath {
+		t.Fatalf("池中句柄数 = %d; want %d", len(pool.handles), maxHandlesPerPath)
+	}
+}
+
+// TestMemFSDirectorySynthesis 确认 MemFS 能从扁平的 map 键中推导出中间目录，
+// 并正确罗列某个虚拟目录下的直接子项
+func TestMemFSDirectorySynthesis(t *testing.T) {
+	fsys := NewMemFS(map[string][]byte{
+		"a.txt":          []byte("a"),
+		"sub/b.txt":      []byte("bb"),
+		"sub/deep/c.txt": []byte("ccc"),
+	})
+
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatalf("Open(a.txt) 失败: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || string(data) != "a" {
+		t.Fatalf("读到 %q, %v; want %q", data, err, "a")
+	}
+
+	root, err := fsys.Open("/")
+	if err != nil {
+		t.Fatalf("Open(/) 失败: %v", err)
+	}
+	info, err := root.Stat()
+	if err != nil || !info.IsDir() {
+		t.Fatalf("根路径应当是目录: %v, %+v", err, info)
+	}
+	entries, err := root.Readdir()
+	if err != nil {
+		t.Fatalf("Readdir(/) 失败: %v", err)
+	}
+	names := entryNames(entries)
+	sort.Strings(names)
+	if want := []string{"a.txt", "sub"}; !equalStrings(names, want) {
+		t.Fatalf("根目录项 = %v; want %v", names, want)
+	}
+
+	sub, err := fsys.Open("sub")
+	if err != nil {
+		t.Fatalf("Open(sub) 失败: %v", err)
+	}
+	entries, err = sub.Readdir()
+	if err != nil {
+		t.Fatalf("Readdir(sub) 失败: %v", err)
+	}
+	names = entryNames(entries)
+	sort.Strings(names)
+	if want := []string{"b.txt", "deep"}; !equalStrings(names, want) {
+		t.Fatalf("sub 目录项 = %v; want %v", names, want)
+	}
+
+	if _, err := fsys.Open("nope"); err == nil {
+		t.Fatalf("不存在的路径应当返回错误")
+	}
+}
+
+func entryNames(infos []FileInfo) []string {
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildTestZip 在内存中构造一个最小的 zip 归档，包含一个顶层文件和一个子目录下的文件
+func buildTestZip(t *testing.T) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("a.txt")
+	if err != nil {
+		t.Fatalf("zip Create(a.txt) 失败: %v", err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("写入 zip 条目失败: %v", err)
+	}
+	w, err = zw.Create("sub/b.txt")
+	if err != nil {
+		t.Fatalf("zip Create(sub/b.txt) 失败: %v", err)
+	}
+	if _, err := w.Write([]byte("world")); err != nil {
+		t.Fatalf("写入 zip 条目失败: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("关闭 zip writer 失败: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("打开 zip reader 失败: %v", err)
+	}
+	return zr
+}
+
+// TestZipFSOpenAndReaddir 确认 ZipFS 能读取归档内的文件内容，
+// 并为归档条目隐含的中间目录正确罗列子项
+func TestZipFSOpenAndReaddir(t *testing.T) {
+	fsys := NewZipFS(buildTestZip(t))
+
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatalf("Open(a.txt) 失败: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("读到 %q, %v; want %q", data, err, "hello")
+	}
+
+	f, err = fsys.Open("sub/b.txt")
+	if err != nil {
+		t.Fatalf("Open(sub/b.txt) 失败: %v", err)
+	}
+	data, err = io.ReadAll(f)
+	if err != nil || string(data) != "world" {
+		t.Fatalf("读到 %q, %v; want %q", data, err, "world")
+	}
+
+	root, err := fsys.Open("/")
+	if err != nil {
+		t.Fatalf("Open(/) 失败: %v", err)
+	}
+	entries, err := root.Readdir()
+	if err != nil {
+		t.Fatalf("Readdir(/) 失败: %v", err)
+	}
+	names := entryNames(entries)
+	sort.Strings(names)
+	if want := []string{"a.txt", "sub"}; !equalStrings(names, want) {
+		t.Fatalf("根目录项 = %v; want %v", names, want)
+	}
+
+	if _, err := fsys.Open("nope"); err == nil {
+		t.Fatalf("不存在的路径应当返回错误")
+	}
+}
+
+// TestMountFSRoutesByLongestPrefix 确认多个文件系统能按 URL 前缀挂载，
+// 且最长匹配前缀优先、请求到达目标文件系统时前缀已被剥离
+func TestMountFSRoutesByLongestPrefix(t *testing.T) {
+	root := NewMemFS(map[string][]byte{"root.txt": []byte("root")})
+	static := NewMemFS(map[string][]byte{"a.js": []byte("static-a")})
+	mount := NewMountFS(map[string]FileSystem{
+		"/":       root,
+		"/static": static,
+	})
+
+	f, err := mount.Open("/root.txt")
+	if err != nil {
+		t.Fatalf("Open(/root.txt) 失败: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "root" {
+		t.Fatalf("根挂载读到 %q; want %q", data, "root")
+	}
+
+	f, err = mount.Open("/static/a.js")
+	if err != nil {
+		t.Fatalf("Open(/static/a.js) 失败: %v", err)
+	}
+	data, _ = io.ReadAll(f)
+	if string(data) != "static-a" {
+		t.Fatalf("static 挂载读到 %q; want %q (前缀应已被剥离)", data, "static-a")
+	}
+
+	if _, err := mount.Open("/static/missing.js"); err == nil {
+		t.Fatalf("static 挂载点内不存在的路径应当返回错误")
+	}
+}
+
+// TestMountFSCreateRequiresWritableMount 确认写入只会转交给实现了 WriteFS 的挂载点，
+// 挂载在某前缀下的只读文件系统（如 ZipFS）应当报错而不是静默失败或写错地方
+func TestMountFSCreateRequiresWritableMount(t *testing.T) {
+	dir := t.TempDir()
+	root := NewDirFS(dir)
+	readonly := NewZipFS(buildTestZip(t))
+	mount := NewMountFS(map[string]FileSystem{
+		"/":        root,
+		"/archive": readonly,
+	})
+
+	w, err := mount.Create("/new.txt")
+	if err != nil {
+		t.Fatalf("Create(/new.txt) 失败: %v", err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("Write 失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close 失败: %v", err)
+	}
+	if !mount.Exists("/new.txt") {
+		t.Fatalf("写入后 Exists(/new.txt) 应为 true")
+	}
+
+	if _, err := mount.Create("/archive/new.txt"); err == nil {
+		t.Fatalf("只读挂载点应当拒绝 Create")
+	}
+}
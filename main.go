@@ -10,9 +10,8 @@ import (
 	"log"
 	"mime"
 	"net"
-	"os"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -33,15 +32,72 @@ const templateStr = `
             <li><a href="{{.URL}}">{{.Name}}</a></li>
         {{end}}
     </ul>
+    <form method="POST" action="{{.CurrentPath}}" enctype="multipart/form-data">
+        <input type="file" name="file">
+        <button type="submit">Upload</button>
+    </form>
 </body>
 </html>
 `
 
+var maxConnPerIP int
+var maxUploadSize int64
+
+// zipMounts 收集 -mount 重复出现的 "URL前缀=归档路径.zip" 项
+type zipMounts []string
+
+func (m *zipMounts) String() string { return strings.Join(*m, ",") }
+
+func (m *zipMounts) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+var mountFlags zipMounts
+
 func init() {
 	flag.StringVar(&rootDir, "d", ".", "工作目录")
+	flag.IntVar(&maxConnPerIP, "max-conn-per-ip", 0, "每个 IP 允许的最大并发连接数（0 表示不限制）")
+	flag.Int64Var(&compressionThreshold, "min-compress-size", defaultCompressionThreshold, "小于该大小（字节）的文件不做压缩")
+	flag.Int64Var(&maxUploadSize, "max-upload-size", 0, "PUT/POST 上传允许的最大字节数（0 表示不限制）")
+	flag.Var(&mountFlags, "mount", "将一个 zip 归档只读挂载到指定 URL 前缀，格式为 前缀=归档路径.zip，可重复指定")
+}
+
+// buildFileSystem 以 -d 指定的目录为 "/" 根构造默认的 DirFS，
+// 再叠加 -mount 指定的各个只读 ZipFS 挂载点；没有任何 -mount 时直接返回
+// DirFS 本身而不包一层 MountFS，使 fileSystem.(WriteFS) 断言和此前行为保持一致
+func buildFileSystem(root string, mounts []string) (FileSystem, error) {
+	rootFS := NewDirFS(root)
+	if len(mounts) == 0 {
+		return rootFS, nil
+	}
+
+	byPrefix := map[string]FileSystem{"/": rootFS}
+	for _, spec := range mounts {
+		prefix, archivePath, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("无效的 -mount 参数 %q，应为 前缀=归档路径.zip", spec)
+		}
+		prefix = path.Clean("/" + prefix)
+		zfs, err := OpenZipFS(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("挂载 %q 失败: %w", spec, err)
+		}
+		byPrefix[prefix] = zfs
+	}
+	return NewMountFS(byPrefix), nil
 }
 
 func main() {
+	flag.Parse()
+
+	fsys, err := buildFileSystem(rootDir, mountFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fileSystem = fsys
+	limiter := newConnLimiter(maxConnPerIP)
+
 	listener, err := net.Listen("tcp", "localhost:8080")
 	if err != nil {
 		log.Fatal(err)
@@ -56,26 +112,39 @@ func main() {
 			log.Println("连接接受错误:", err)
 			continue
 		}
-		go handleConnection(conn)
+
+		ip := remoteIP(conn.RemoteAddr())
+		if !limiter.acquire(ip) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer limiter.release(ip)
+			handleConnection(conn)
+		}()
 	}
 }
 
-// handleConnection 处理单个连接的 HTTP 请求
+// handleConnection 处理单个连接的 HTTP 请求。
+// reader 在连接的整个生命周期内只创建一次，使 PUT/POST 读取完请求体后，
+// 紧随其后的下一个 keep-alive 请求仍能从同一个缓冲读取器里接着读，不会丢失或错读字节
 func handleConnection(conn net.Conn) {
 	defer conn.Close()
+	reader := bufio.NewReader(conn)
 	for {
 		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		req, err := readHTTPRequest(conn)
+		req, err := readHTTPRequest(reader)
 		if err != nil {
 			log.Println("读取 HTTP 请求错误:", err)
 			break
 		}
 		keepAlive := shouldKeepAlive(req)
-		if err := processHTTPRequest(conn, req, keepAlive); err != nil {
+		keepAliveUsed, err := processHTTPRequest(conn, reader, req, keepAlive)
+		if err != nil {
 			log.Println("处理请求错误:", err)
 			break
 		}
-		if !keepAlive {
+		if !keepAliveUsed {
 			if tcpConn, ok := conn.(*net.TCPConn); ok {
 				tcpConn.CloseWrite()
 			}
@@ -93,26 +162,30 @@ func getMimeType(filename string) string {
 	return mType
 }
 
+// fileSystem 是处理请求路径所挂载的根文件系统，默认挂载 rootDir（见 main）
+var fileSystem FileSystem
+
 // getFile 根据请求路径返回对应文件或目录内容
-func getFile(path string) (io.ReadSeeker, string) {
-	cleanPath := filepath.Clean(path)
-	fullPath := filepath.Join(rootDir, cleanPath)
-	info, err := os.Stat(fullPath)
+func getFile(reqPath string) (File, string) {
+	f, err := fileSystem.Open(reqPath)
+	if err != nil {
+		log.Println("路径打开错误:", err)
+		return nil, ""
+	}
+	info, err := f.Stat()
 	if err != nil {
 		log.Println("路径状态错误:", err)
+		f.Close()
 		return nil, ""
 	}
 
 	if info.IsDir() {
-		return generateDirectoryPage(fullPath, cleanPath), "text/html"
-	}
-
-	file, err := os.Open(fullPath)
-	if err != nil {
-		log.Println("文件打开错误:", err)
-		return nil, ""
+		currentURL := path.Join("/", reqPath)
+		page := generateDirectoryPage(f, currentURL)
+		f.Close()
+		return page, "text/html"
 	}
-	return file, getMimeType(fullPath)
+	return f, getMimeType(info.Name())
 }
 
 type DirEntry struct {
@@ -120,16 +193,16 @@ type DirEntry struct {
 	URL  string
 }
 
-func listDirectoryEntries(dirPath, currentURL string) ([]DirEntry, error) {
-	entries, err := os.ReadDir(dirPath)
+func listDirectoryEntries(dir File, currentURL string) ([]DirEntry, error) {
+	infos, err := dir.Readdir()
 	if err != nil {
 		return nil, err
 	}
 	var result []DirEntry
-	for _, entry := range entries {
-		name := entry.Name()
-		url := filepath.Join(currentURL, name)
-		if entry.IsDir() {
+	for _, info := range infos {
+		name := info.Name()
+		url := path.Join(currentURL, name)
+		if info.IsDir() {
 			url += "/"
 		}
 		result = append(result, DirEntry{Name: name, URL: url})
@@ -142,10 +215,10 @@ type DirListingData struct {
 	Entries     []DirEntry
 }
 
-func generateDirectoryPage(fsDir, currentURL string) io.ReadSeeker {
-	entries, err := listDirectoryEntries(fsDir, currentURL)
+func generateDirectoryPage(dir File, currentURL string) File {
+	entries, err := listDirectoryEntries(dir, currentURL)
 	if err != nil {
-		return strings.NewReader("读取目录错误")
+		return newMemFile("index.html", []byte("读取目录错误"), time.Now())
 	}
 
 	data := DirListingData{
@@ -156,48 +229,131 @@ func generateDirectoryPage(fsDir, currentURL string) io.ReadSeeker {
 	var buf bytes.Buffer
 	tmpl, err := template.New("dirList").Parse(templateStr)
 	if err != nil {
-		return strings.NewReader("模板解析错误")
+		return newMemFile("index.html", []byte("模板解析错误"), time.Now())
 	}
 
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return strings.NewReader("生成页面错误")
+		return newMemFile("index.html", []byte("生成页面错误"), time.Now())
 	}
 
-	return bytes.NewReader(buf.Bytes())
+	return newMemFile("index.html", buf.Bytes(), time.Now())
 }
 
-// processHTTPRequest 仅处理 GET 请求
-func processHTTPRequest(conn net.Conn, req *HTTPRequest, keepAlive bool) error {
-	if req.Method != "GET" {
-		resp := "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
-		conn.Write([]byte(resp))
-		return nil
+// processHTTPRequest 处理 GET、HEAD、PUT 和 POST 请求；reader 是该连接共享的缓冲读取器，
+// PUT/POST 需要用它读取请求体。返回值 keepAliveUsed 是这次响应实际承诺给客户端的连接状态
+// （不一定等于入参 keepAlive——例如请求体长度未知、无法安全丢弃时必须强制关闭），
+// handleConnection 必须依据它、而不是请求头推导出的 keepAlive 来决定是否继续循环，
+// 否则响应头和服务器实际行为会自相矛盾
+func processHTTPRequest(conn net.Conn, reader *bufio.Reader, req *HTTPRequest, keepAlive bool) (keepAliveUsed bool, err error) {
+	switch req.Method {
+	case "PUT":
+		return handlePut(conn, reader, req, keepAlive)
+	case "POST":
+		return handlePost(conn, reader, req, keepAlive)
+	case "GET", "HEAD":
+		// 继续往下走只读路径
+	default:
+		// 未知方法可能仍带着请求体，但既不知道长度也没有去读它，无法安全复用连接
+		writeSimpleStatus(conn, "405 Method Not Allowed", false)
+		return false, nil
+	}
+
+	f, mimeType := getFile(req.Path)
+	if f == nil {
+		writeSimpleStatus(conn, "404 Not Found", keepAlive)
+		return keepAlive, nil
+	}
+	defer f.Close()
+
+	info, statErr := f.Stat()
+	if statErr != nil {
+		writeSimpleStatus(conn, "500 Internal Server Error", keepAlive)
+		return keepAlive, statErr
+	}
+	var ra io.ReaderAt
+	if r, ok := f.(io.ReaderAt); ok {
+		ra = r
+	}
+	etag := computeETag(info, ra)
+	modTime := info.ModTime()
+
+	if req.Method == "HEAD" {
+		if handled, err := respondIfNotModified(conn, req, etag, modTime, keepAlive); handled {
+			return keepAlive, err
+		}
+		return keepAlive, serveHead(conn, f, mimeType, etag, modTime, keepAlive)
 	}
 
-	fileRS, mimeType := getFile(req.Path)
-	if fileRS == nil {
-		resp := "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
-		conn.Write([]byte(resp))
-		return nil
+	if _, ok := req.Headers["range"]; ok {
+		if handled, err := respondIfNotModified(conn, req, etag, modTime, keepAlive); handled {
+			return keepAlive, err
+		}
+		return keepAlive, handleRangeRequest(conn, req, f, mimeType, etag, modTime, keepAlive)
 	}
 
-	if _, ok := req.Headers["range"]; ok {
-		return handleRangeRequest(conn, req, fileRS, mimeType, keepAlive)
+	// 压缩响应的 Content-Encoding 会改变响应体本身，因此条件请求判断必须针对
+	// 按编码区分过的 ETag 进行，而不是未压缩内容的 etag，否则客户端可能把
+	// 某种编码下缓存的响应体，当成 identity（或另一种编码）请求的有效缓存命中
+	encoding, pf := negotiateEncoding(req, mimeType, req.Path, info.Size())
+	effectiveETag := etagForEncoding(etag, encoding)
+	if handled, err := respondIfNotModified(conn, req, effectiveETag, modTime, keepAlive); handled {
+		if pf != nil {
+			pf.Close()
+		}
+		return keepAlive, err
 	}
 
-	content, err := io.ReadAll(fileRS)
+	if pf != nil {
+		defer pf.Close()
+		return keepAlive, servePrecompressed(conn, pf, mimeType, encoding, effectiveETag, modTime, keepAlive)
+	}
+	if encoding == "gzip" {
+		// Transfer-Encoding: chunked 是 HTTP/1.1 特性（RFC 7230 3.3.1），HTTP/1.0
+		// 客户端无法解析分块响应体，必须改为先压缩到内存再发固定 Content-Length
+		if req.Version == "HTTP/1.1" {
+			return keepAlive, serveGzipChunked(conn, f, mimeType, effectiveETag, modTime, keepAlive)
+		}
+		return keepAlive, serveGzipBuffered(conn, f, mimeType, effectiveETag, modTime, keepAlive)
+	}
+
+	return keepAlive, serveFullContent(conn, f, mimeType, etag, modTime, keepAlive)
+}
+
+// connStateHeaderValue 根据是否保活返回 Connection 头的值
+func connStateHeaderValue(keepAlive bool) string {
+	if keepAlive {
+		return "keep-alive"
+	}
+	return "close"
+}
+
+// serveHead 只返回状态行和头部（Content-Length、Content-Type、Accept-Ranges、ETag、Last-Modified），
+// 不含响应体，供分段下载客户端在发起并发 Range 请求前探测文件大小和是否支持 Range
+func serveHead(conn net.Conn, f File, mimeType, etag string, modTime time.Time, keepAlive bool) error {
+	info, err := f.Stat()
 	if err != nil {
 		resp := "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
 		conn.Write([]byte(resp))
 		return err
 	}
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\nAccept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n",
+		info.Size(), mimeType, etag, formatHTTPDate(modTime), connStateHeaderValue(keepAlive))
+	_, err = conn.Write([]byte(header))
+	return err
+}
 
-	connState := "keep-alive"
-	if !keepAlive {
-		connState = "close"
+// serveFullContent 以 200 OK 返回整个文件内容，并始终声明 Accept-Ranges、ETag、Last-Modified，
+// 以便客户端（如分段下载器或带缓存的浏览器）后续改用并发 Range 请求或条件请求
+func serveFullContent(conn net.Conn, rs io.ReadSeeker, mimeType, etag string, modTime time.Time, keepAlive bool) error {
+	content, err := io.ReadAll(rs)
+	if err != nil {
+		resp := "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+		conn.Write([]byte(resp))
+		return err
 	}
-	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\nConnection: %s\r\n\r\n",
-		len(content), mimeType, connState)
+
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\nAccept-Ranges: bytes\r\nETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n",
+		len(content), mimeType, etag, formatHTTPDate(modTime), connStateHeaderValue(keepAlive))
 	conn.Write([]byte(header))
 	conn.Write(content)
 	return nil
@@ -210,9 +366,7 @@ type HTTPRequest struct {
 	Headers map[string]string
 }
 
-func readHTTPRequest(conn net.Conn) (*HTTPRequest, error) {
-	reader := bufio.NewReader(conn)
-
+func readHTTPRequest(reader *bufio.Reader) (*HTTPRequest, error) {
 	// 读取请求行，如 "GET /path HTTP/1.1"
 	line, err := reader.ReadString('\n')
 	if err != nil {
@@ -260,84 +414,3 @@ func shouldKeepAlive(req *HTTPRequest) bool {
 	}
 	return false
 }
-
-func parseRangeHeader(rangeHeader string, fileSize int64) (start, end int64, err error) {
-	const prefix = "bytes="
-	if !strings.HasPrefix(rangeHeader, prefix) {
-		return 0, 0, fmt.Errorf("无效的 Range 头")
-	}
-	spec := strings.TrimPrefix(rangeHeader, prefix)
-	parts := strings.Split(spec, "-")
-	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("无效的 Range 规范")
-	}
-	if parts[0] == "" { // 后缀范围，如 "-500"
-		suffix, err := strconv.ParseInt(parts[1], 10, 64)
-		if err != nil {
-			return 0, 0, err
-		}
-		if suffix > fileSize {
-			suffix = fileSize
-		}
-		return fileSize - suffix, fileSize - 1, nil
-	}
-	start, err = strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, 0, err
-	}
-	if parts[1] != "" {
-		end, err = strconv.ParseInt(parts[1], 10, 64)
-		if err != nil {
-			return 0, 0, err
-		}
-	} else {
-		end = fileSize - 1
-	}
-	if start > end || end >= fileSize {
-		return 0, 0, fmt.Errorf("无效的 Range: start=%d, end=%d, fileSize=%d", start, end, fileSize)
-	}
-	return start, end, nil
-}
-
-func handleRangeRequest(conn net.Conn, req *HTTPRequest, rs io.ReadSeeker, mimeType string, keepAlive bool) error {
-	file, ok := rs.(*os.File)
-	if !ok {
-		resp := "HTTP/1.1 416 Range Not Satisfiable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
-		conn.Write([]byte(resp))
-		return fmt.Errorf("不支持 Range 请求")
-	}
-	fi, err := file.Stat()
-	if err != nil {
-		return err
-	}
-	fileSize := fi.Size()
-
-	rangeHeader := req.Headers["range"]
-	start, end, err := parseRangeHeader(rangeHeader, fileSize)
-	if err != nil {
-		resp := "HTTP/1.1 416 Range Not Satisfiable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
-		conn.Write([]byte(resp))
-		return err
-	}
-	length := end - start + 1
-
-	_, err = rs.Seek(start, io.SeekStart)
-	if err != nil {
-		return err
-	}
-	content := make([]byte, length)
-	n, err := io.ReadFull(rs, content)
-	if err != nil || int64(n) != length {
-		return fmt.Errorf("读取 Range 内容失败")
-	}
-
-	connState := "keep-alive"
-	if !keepAlive {
-		connState = "close"
-	}
-	header := fmt.Sprintf("HTTP/1.1 206 Partial Content\r\nContent-Length: %d\r\nContent-Type: %s\r\n", len(content), mimeType)
-	header += fmt.Sprintf("Content-Range: bytes %d-%d/%d\r\nConnection: %s\r\n\r\n", start, end, fileSize, connState)
-	conn.Write([]byte(header))
-	conn.Write(content)
-	return nil
-}
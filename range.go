@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileDescriptorProvider 是本地磁盘文件句柄的可选接口：实现它即表示
+// 可以把底层 *os.File 交给 sendFile 做零拷贝发送，而不是先读进内存再写出
+type fileDescriptorProvider interface {
+	osFile() *os.File
+}
+
+// httpRange 表示一个已针对文件大小校验过的字节范围 [start, end]（闭区间）
+type httpRange struct {
+	start, end int64
+}
+
+func (r httpRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// errNoOverlap 表示所请求的范围集合相互重叠或总量超出文件大小，
+// 继续按多重范围处理已不划算，调用方应回退为完整文件响应（200 OK）
+var errNoOverlap = errors.New("range 请求总量超出文件大小，放弃多重范围")
+
+// parseRangeHeader 解析形如 "bytes=0-4,10-20,-5" 的 Range 头，
+// 返回针对 fileSize 校验过的范围列表。
+// 单个语法错误或不可满足的范围会被跳过；若全部范围都不可满足，返回错误。
+// 若所有范围均有效但总字节数超过文件大小（如相互重叠），返回 errNoOverlap。
+func parseRangeHeader(rangeHeader string, fileSize int64) ([]httpRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rangeHeader, prefix) {
+		return nil, fmt.Errorf("无效的 Range 头")
+	}
+	spec := strings.TrimPrefix(rangeHeader, prefix)
+	if spec == "" {
+		return nil, fmt.Errorf("无效的 Range 头")
+	}
+
+	var ranges []httpRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		dash := strings.IndexByte(part, '-')
+		if dash < 0 {
+			continue
+		}
+		startStr, endStr := part[:dash], part[dash+1:]
+
+		var start, end int64
+		if startStr == "" {
+			// 后缀范围，如 "-500" 表示最后 500 字节
+			suffix, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || suffix <= 0 {
+				continue
+			}
+			if suffix > fileSize {
+				suffix = fileSize
+			}
+			start = fileSize - suffix
+			end = fileSize - 1
+		} else {
+			var err error
+			start, err = strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				continue
+			}
+			if endStr == "" {
+				end = fileSize - 1
+			} else {
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					continue
+				}
+			}
+		}
+		if fileSize == 0 || start >= fileSize {
+			continue
+		}
+		if end >= fileSize {
+			end = fileSize - 1
+		}
+		ranges = append(ranges, httpRange{start: start, end: end})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("没有可满足的 Range: %s", rangeHeader)
+	}
+
+	var total int64
+	for _, r := range ranges {
+		total += r.length()
+	}
+	if total > fileSize {
+		return nil, errNoOverlap
+	}
+
+	return ranges, nil
+}
+
+// handleRangeRequest 处理带 Range 头的 GET 请求。
+// 单一范围返回 206 + Content-Range；多个范围返回 206 + multipart/byteranges；
+// 范围总量超出文件大小（重叠、浪费）或 If-Range 校验器不匹配时回退为 200 整文件；
+// 全部不可满足时返回 416。
+func handleRangeRequest(conn net.Conn, req *HTTPRequest, rs io.ReadSeeker, mimeType, etag string, modTime time.Time, keepAlive bool) error {
+	ra, ok := rs.(io.ReaderAt)
+	if !ok {
+		resp := "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+		conn.Write([]byte(resp))
+		return fmt.Errorf("文件不支持按偏移量读取")
+	}
+	fileSize, err := seekerSize(rs)
+	if err != nil {
+		return err
+	}
+
+	if !ifRangeSatisfied(req, etag, modTime) {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return serveFullContent(conn, rs, mimeType, etag, modTime, keepAlive)
+	}
+
+	ranges, err := parseRangeHeader(req.Headers["range"], fileSize)
+	if err == errNoOverlap {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return serveFullContent(conn, rs, mimeType, etag, modTime, keepAlive)
+	}
+	if err != nil {
+		resp := fmt.Sprintf("HTTP/1.1 416 Range Not Satisfiable\r\nContent-Range: bytes */%d\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", fileSize)
+		conn.Write([]byte(resp))
+		return err
+	}
+
+	connState := connStateHeaderValue(keepAlive)
+
+	if len(ranges) == 1 {
+		return serveSingleRange(conn, ra, ranges[0], mimeType, etag, modTime, fileSize, connState)
+	}
+	return serveMultipartRanges(conn, ra, ranges, mimeType, etag, modTime, fileSize, connState)
+}
+
+func serveSingleRange(conn net.Conn, ra io.ReaderAt, r httpRange, mimeType, etag string, modTime time.Time, fileSize int64, connState string) error {
+	header := fmt.Sprintf("HTTP/1.1 206 Partial Content\r\nContent-Length: %d\r\nContent-Type: %s\r\n", r.length(), mimeType)
+	header += fmt.Sprintf("ETag: %s\r\nLast-Modified: %s\r\n", etag, formatHTTPDate(modTime))
+	header += fmt.Sprintf("Content-Range: bytes %d-%d/%d\r\nConnection: %s\r\n\r\n", r.start, r.end, fileSize, connState)
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+
+	return rangeWorkers.run(func() error {
+		if fp, ok := ra.(fileDescriptorProvider); ok {
+			if sent, err := sendFile(conn, fp.osFile(), r.start, r.length()); err != nil {
+				return err
+			} else if sent {
+				return nil
+			}
+		}
+
+		content := make([]byte, r.length())
+		if _, err := ra.ReadAt(content, r.start); err != nil && err != io.EOF {
+			return err
+		}
+		_, err := conn.Write(content)
+		return err
+	})
+}
+
+// serveMultipartRanges 以 multipart/byteranges 格式返回多个范围，
+// 响应长度在发送前预先算好（各分段头 + 数据 + 结尾边界），因此无需分块传输
+func serveMultipartRanges(conn net.Conn, ra io.ReaderAt, ranges []httpRange, mimeType, etag string, modTime time.Time, fileSize int64, connState string) error {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return err
+	}
+
+	partHeaders := make([]string, len(ranges))
+	var total int64
+	for i, r := range ranges {
+		partHeaders[i] = fmt.Sprintf("--%s\r\nContent-Type: %s\r\nContent-Range: bytes %d-%d/%d\r\n\r\n",
+			boundary, mimeType, r.start, r.end, fileSize)
+		total += int64(len(partHeaders[i])) + r.length() + 2 // +2: 分段数据后的 CRLF
+	}
+	closing := fmt.Sprintf("--%s--\r\n", boundary)
+	total += int64(len(closing))
+
+	header := fmt.Sprintf("HTTP/1.1 206 Partial Content\r\nContent-Length: %d\r\nContent-Type: multipart/byteranges; boundary=%s\r\n", total, boundary)
+	header += fmt.Sprintf("ETag: %s\r\nLast-Modified: %s\r\nConnection: %s\r\n\r\n", etag, formatHTTPDate(modTime), connState)
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+
+	for i, r := range ranges {
+		if _, err := conn.Write([]byte(partHeaders[i])); err != nil {
+			return err
+		}
+		err := rangeWorkers.run(func() error {
+			buf := make([]byte, r.length())
+			if _, err := ra.ReadAt(buf, r.start); err != nil && err != io.EOF {
+				return err
+			}
+			_, err := conn.Write(buf)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write([]byte("\r\n")); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Write([]byte(closing))
+	return err
+}
+
+func randomBoundary() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", buf), nil
+}
+
+// seekerSize 在不丢失当前读取位置的前提下探测底层数据的总大小
+func seekerSize(s io.Seeker) (int64, error) {
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// sendFile 尝试通过 Linux 的 sendfile(2) 把 f 从 offset 起的 n 字节零拷贝地写入 conn，
+// 完全绕开用户态缓冲区。仅当 conn 是 *net.TCPConn 时可用；其他情况返回 ok=false
+// 交由调用方回退到普通的 Read+Write
+func sendFile(conn net.Conn, f *os.File, offset, n int64) (ok bool, err error) {
+	tcpConn, isTCP := conn.(*net.TCPConn)
+	if !isTCP {
+		return false, nil
+	}
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return false, nil
+	}
+
+	remaining := n
+	off := offset
+	const maxChunk = 1 << 30 // sendfile 单次调用的分块上限
+	var sendErr error
+	// 用 Write 而不是 Control：遇到 EAGAIN 时返回 false 把控制权交还给运行时的网络
+	// poller，待 fd 重新可写时再被调用，而不是在 Control 回调里忙轮询烧 CPU
+	ctrlErr := rawConn.Write(func(fd uintptr) (done bool) {
+		for remaining > 0 {
+			chunk := remaining
+			if chunk > maxChunk {
+				chunk = maxChunk
+			}
+			written, serr := syscall.Sendfile(int(fd), int(f.Fd()), &off, int(chunk))
+			if serr != nil {
+				if serr == syscall.EAGAIN {
+					return false
+				}
+				if serr == syscall.EINTR {
+					continue
+				}
+				sendErr = serr
+				return true
+			}
+			if written == 0 {
+				sendErr = io.ErrUnexpectedEOF
+				return true
+			}
+			remaining -= int64(written)
+		}
+		return true
+	})
+	if ctrlErr != nil {
+		return false, ctrlErr
+	}
+	if sendErr != nil {
+		return false, sendErr
+	}
+	return true, nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+// sendFile 在没有 sendfile(2) 的平台上退化为普通拷贝，但仍然跳过把整个分段读入
+// 一个中间 []byte 切片的步骤
+func sendFile(conn net.Conn, f *os.File, offset, n int64) (ok bool, err error) {
+	if _, err := io.Copy(conn, io.NewSectionReader(f, offset, n)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// contentLength 解析请求的 Content-Length 头，PUT/POST 都需要依据它知道要读多少字节的请求体
+func contentLength(req *HTTPRequest) (int64, error) {
+	v, ok := req.Headers["content-length"]
+	if !ok {
+		return 0, fmt.Errorf("缺少 Content-Length 头")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的 Content-Length: %q", v)
+	}
+	return n, nil
+}
+
+// allowsOverwrite 判断是否应当按 If-Match: * 语义允许覆盖已存在的目标
+func allowsOverwrite(req *HTTPRequest) bool {
+	return strings.TrimSpace(req.Headers["if-match"]) == "*"
+}
+
+// writeSimpleStatus 发送一个无响应体的状态行，用于上传处理器中的各类错误响应。
+// keepAlive 必须如实反映共享的连接读取器此刻是否与客户端同步——调用方如果还没有
+// 读完（或根本不知道该读多少）请求体，就必须传 false 强制关闭连接，
+// 否则下一个 keep-alive 请求会从请求体中间的字节开始被错误地当成新请求解析
+func writeSimpleStatus(conn net.Conn, status string, keepAlive bool) {
+	resp := fmt.Sprintf("HTTP/1.1 %s\r\nContent-Length: 0\r\nConnection: %s\r\n\r\n", status, connStateHeaderValue(keepAlive))
+	conn.Write([]byte(resp))
+}
+
+// handlePut 处理 "PUT /path"：把请求体原样写入 path。
+// 要求底层 FileSystem 支持写入（否则 405），要求 Content-Length（否则 411），
+// 超过 -max-upload-size 返回 413，目标已存在且未带 If-Match: * 返回 409。
+// 返回值是这次响应实际承诺的连接状态，调用方必须据此决定是否继续在该连接上读下一个请求
+func handlePut(conn net.Conn, reader *bufio.Reader, req *HTTPRequest, keepAlive bool) (bool, error) {
+	wfs, ok := fileSystem.(WriteFS)
+	if !ok {
+		// 还没有读取 Content-Length、更没有读请求体，无法安全复用连接
+		writeSimpleStatus(conn, "405 Method Not Allowed", false)
+		return false, nil
+	}
+
+	length, err := contentLength(req)
+	if err != nil {
+		// Content-Length 缺失或非法，不知道请求体有多长、无法安全丢弃，必须关闭
+		writeSimpleStatus(conn, "411 Length Required", false)
+		return false, nil
+	}
+	if maxUploadSize > 0 && length > maxUploadSize {
+		io.CopyN(io.Discard, reader, length)
+		writeSimpleStatus(conn, "413 Payload Too Large", keepAlive)
+		return keepAlive, nil
+	}
+	if wfs.Exists(req.Path) && !allowsOverwrite(req) {
+		io.CopyN(io.Discard, reader, length)
+		writeSimpleStatus(conn, "409 Conflict", keepAlive)
+		return keepAlive, nil
+	}
+
+	w, err := wfs.Create(req.Path)
+	if err != nil {
+		io.CopyN(io.Discard, reader, length)
+		writeSimpleStatus(conn, "500 Internal Server Error", keepAlive)
+		return keepAlive, err
+	}
+	if _, err := io.CopyN(w, reader, length); err != nil {
+		w.Close()
+		// 复制请求体中途出错，读取器位置已经不可知，必须关闭
+		writeSimpleStatus(conn, "500 Internal Server Error", false)
+		return false, err
+	}
+	if err := w.Close(); err != nil {
+		writeSimpleStatus(conn, "500 Internal Server Error", keepAlive)
+		return keepAlive, err
+	}
+
+	header := fmt.Sprintf("HTTP/1.1 201 Created\r\nLocation: %s\r\nContent-Length: 0\r\nConnection: %s\r\n\r\n",
+		path.Join("/", req.Path), connStateHeaderValue(keepAlive))
+	_, err = conn.Write([]byte(header))
+	return keepAlive, err
+}
+
+// errUploadConflict 表示 POST 上传中某个分段的目标路径已存在且未带 If-Match: * 允许覆盖
+var errUploadConflict = errors.New("上传目标已存在")
+
+// handlePost 处理 "POST /path"：解析 multipart/form-data 请求体，把每个带文件名的分段
+// 直接流式写入 path 目录下的目标文件（经 wfs.Create 的临时文件 + 原子 rename），
+// 不在内存中攒积整个请求体或任何分段的数据，避免大文件上传把进程内存撑爆。
+// 返回值是这次响应实际承诺的连接状态，调用方必须据此决定是否继续在该连接上读下一个请求
+func handlePost(conn net.Conn, reader *bufio.Reader, req *HTTPRequest, keepAlive bool) (bool, error) {
+	wfs, ok := fileSystem.(WriteFS)
+	if !ok {
+		// 还没有读取 Content-Length、更没有读请求体，无法安全复用连接
+		writeSimpleStatus(conn, "405 Method Not Allowed", false)
+		return false, nil
+	}
+
+	boundary, ok := multipartBoundary(req.Headers["content-type"])
+	if !ok {
+		// 同上：此时还不知道请求体长度，无法安全丢弃
+		writeSimpleStatus(conn, "400 Bad Request", false)
+		return false, nil
+	}
+
+	length, err := contentLength(req)
+	if err != nil {
+		writeSimpleStatus(conn, "411 Length Required", false)
+		return false, nil
+	}
+	if maxUploadSize > 0 && length > maxUploadSize {
+		io.CopyN(io.Discard, reader, length)
+		writeSimpleStatus(conn, "413 Payload Too Large", keepAlive)
+		return keepAlive, nil
+	}
+
+	body := bufio.NewReader(io.LimitReader(reader, length))
+	location, err := streamMultipartParts(body, boundary, wfs, req.Path, allowsOverwrite(req))
+	// 无论解析是否提前出错，都把声明的 Content-Length 余下的字节读空，
+	// 使共享的连接读取器与下一次 keep-alive 请求保持同步
+	io.Copy(io.Discard, body)
+
+	switch {
+	case errors.Is(err, errUploadConflict):
+		writeSimpleStatus(conn, "409 Conflict", keepAlive)
+		return keepAlive, nil
+	case err != nil:
+		writeSimpleStatus(conn, "400 Bad Request", keepAlive)
+		return keepAlive, err
+	case location == "":
+		writeSimpleStatus(conn, "400 Bad Request", keepAlive)
+		return keepAlive, nil
+	}
+
+	header := fmt.Sprintf("HTTP/1.1 201 Created\r\nLocation: %s\r\nContent-Length: 0\r\nConnection: %s\r\n\r\n",
+		location, connStateHeaderValue(keepAlive))
+	_, err = conn.Write([]byte(header))
+	return keepAlive, err
+}
+
+// multipartBoundary 从 Content-Type 头里提取 multipart/form-data 的 boundary 参数
+func multipartBoundary(contentType string) (string, bool) {
+	fields := strings.Split(contentType, ";")
+	if len(fields) == 0 || !strings.EqualFold(strings.TrimSpace(fields[0]), "multipart/form-data") {
+		return "", false
+	}
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		if v, ok := strings.CutPrefix(field, "boundary="); ok {
+			return strings.Trim(v, `"`), true
+		}
+	}
+	return "", false
+}
+
+// streamMultipartParts 是一个按行扫描的流式状态机，思路与标准库 mime/multipart 类似，
+// 但直接在扫描过程中把每个带文件名分段的数据写给 wfs.Create 返回的临时文件句柄，
+// 从不在内存里攒积一整个分段。返回最后一次成功写入的目标路径（供 Location 头使用）
+func streamMultipartParts(body *bufio.Reader, boundary string, wfs WriteFS, basePath string, overwrite bool) (string, error) {
+	delimLine := "--" + boundary
+	delimEnd := delimLine + "--"
+
+	// 跳过起始边界之前的 preamble（规范允许存在，但本服务产生的请求体里通常为空）
+	for foundStart := false; !foundStart; {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("未找到 multipart 边界: %w", err)
+		}
+		switch strings.TrimRight(line, "\r\n") {
+		case delimEnd:
+			return "", fmt.Errorf("multipart 请求体中没有任何分段")
+		case delimLine:
+			foundStart = true
+		}
+	}
+
+	var location string
+	for {
+		headerBlock, err := readMultipartHeaders(body)
+		if err != nil {
+			return location, err
+		}
+		_, filename := parseContentDisposition(headerBlock)
+
+		var dst io.WriteCloser
+		var target string
+		if filename != "" {
+			target = path.Join(basePath, path.Base(filename))
+			if wfs.Exists(target) && !overwrite {
+				streamPartTo(body, delimLine, io.Discard)
+				return location, errUploadConflict
+			}
+			if dst, err = wfs.Create(target); err != nil {
+				return location, err
+			}
+		}
+
+		final, err := streamPartTo(body, delimLine, writerOrDiscard(dst))
+		if dst != nil {
+			if closeErr := dst.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return location, err
+		}
+		if filename != "" {
+			location = path.Join("/", target)
+		}
+		if final {
+			return location, nil
+		}
+	}
+}
+
+func writerOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
+
+// readMultipartHeaders 逐行读取一个分段的头部，直到遇到空行为止，
+// 返回以 "\r\n" 连接的头部文本供 parseContentDisposition 解析
+func readMultipartHeaders(body *bufio.Reader) (string, error) {
+	var lines []string
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" {
+			return strings.Join(lines, "\r\n"), nil
+		}
+		lines = append(lines, trimmed)
+	}
+}
+
+// streamPartTo 把当前分段的数据以定长块扫描的方式写给 w，直到在数据流中找到
+// "\r\n--boundary" 分隔符为止。扫描只依赖 bufio.Reader 的 Peek/Discard，不按行读取，
+// 因此没有换行符的二进制分段（例如图片、zip）也不会在写出前被整段缓冲到内存里。
+// 紧邻分隔符之前的那个 CRLF 属于分段间的框架而非数据内容，不会写入。
+// final 表示紧随分隔符之后的是表示结束的 "--"
+func streamPartTo(body *bufio.Reader, delimLine string, w io.Writer) (final bool, err error) {
+	needle := []byte("\r\n" + delimLine)
+	for {
+		window := body.Size()
+		peeked, peekErr := body.Peek(window)
+
+		if idx := bytes.Index(peeked, needle); idx >= 0 {
+			if idx > 0 {
+				if _, err := w.Write(peeked[:idx]); err != nil {
+					return false, err
+				}
+			}
+			body.Discard(idx + len(needle))
+			return consumeBoundaryTrailer(body)
+		}
+
+		if len(peeked) == 0 && peekErr != nil {
+			return false, fmt.Errorf("未找到 multipart 分段结束边界: %w", peekErr)
+		}
+
+		// 末尾 len(needle)-1 个字节可能是跨越下一次 Peek 的分隔符前缀，保留它们
+		// 不输出、不丢弃，其余部分可以安全地写出并从读取器中移除
+		safe := len(peeked) - (len(needle) - 1)
+		if safe <= 0 {
+			if peekErr != nil {
+				return false, fmt.Errorf("未找到 multipart 分段结束边界: %w", peekErr)
+			}
+			// window 太小装不下 needle，理论上不会发生（bufio 默认缓冲区远大于边界长度）
+			return false, fmt.Errorf("multipart 边界过长，无法匹配")
+		}
+		if _, err := w.Write(peeked[:safe]); err != nil {
+			return false, err
+		}
+		body.Discard(safe)
+	}
+}
+
+// consumeBoundaryTrailer 在分隔符 "\r\n--boundary" 被整体 Discard 之后调用，
+// 读掉这一行剩余的字节（普通分隔符是 "\r\n"，结束分隔符是 "--\r\n"，
+// RFC 2046 还允许结束分隔符后带 transport-padding），并报告是否是结束分隔符
+func consumeBoundaryTrailer(body *bufio.Reader) (final bool, err error) {
+	rest, err := body.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(rest, "--"), nil
+}
+
+// parseContentDisposition 从分段头部中提取 Content-Disposition 的 name 和 filename 参数
+func parseContentDisposition(headerBlock string) (name, filename string) {
+	for _, line := range strings.Split(headerBlock, "\r\n") {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(line[:colon]), "Content-Disposition") {
+			continue
+		}
+		for _, field := range strings.Split(line[colon+1:], ";") {
+			field = strings.TrimSpace(field)
+			if v, ok := strings.CutPrefix(field, `name="`); ok {
+				name = strings.TrimSuffix(v, `"`)
+			} else if v, ok := strings.CutPrefix(field, `filename="`); ok {
+				filename = strings.TrimSuffix(v, `"`)
+			}
+		}
+	}
+	return name, filename
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeWriteFS 是一个纯内存的 WriteFS 实现，只用于测试 streamMultipartParts，
+// 避免真的去碰磁盘；Open 不会被这些测试用到
+type fakeWriteFS struct {
+	files map[string][]byte
+}
+
+func newFakeWriteFS() *fakeWriteFS {
+	return &fakeWriteFS{files: make(map[string][]byte)}
+}
+
+func (f *fakeWriteFS) Open(name string) (File, error) {
+	return nil, errors.New("fakeWriteFS.Open 未实现")
+}
+
+func (f *fakeWriteFS) Exists(name string) bool {
+	_, ok := f.files[name]
+	return ok
+}
+
+func (f *fakeWriteFS) Create(name string) (io.WriteCloser, error) {
+	return &fakeWriteCloser{fs: f, name: name}, nil
+}
+
+type fakeWriteCloser struct {
+	fs   *fakeWriteFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *fakeWriteCloser) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *fakeWriteCloser) Close() error {
+	w.fs.files[w.name] = append([]byte(nil), w.buf.Bytes()...)
+	return nil
+}
+
+func TestStreamMultipartPartsWritesFileDirectly(t *testing.T) {
+	const boundary = "X-TEST-BOUNDARY"
+	raw := "" +
+		"--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="file"; filename="hello.txt"` + "\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hello\r\nworld" + "\r\n" +
+		"--" + boundary + "--\r\n"
+
+	wfs := newFakeWriteFS()
+	body := bufio.NewReader(strings.NewReader(raw))
+	location, err := streamMultipartParts(body, boundary, wfs, "/up", false)
+	if err != nil {
+		t.Fatalf("streamMultipartParts 返回错误: %v", err)
+	}
+	if location != "/up/hello.txt" {
+		t.Fatalf("location = %q; want /up/hello.txt", location)
+	}
+	got := string(wfs.files["/up/hello.txt"])
+	if got != "hello\r\nworld" {
+		t.Fatalf("文件内容 = %q; want %q", got, "hello\r\nworld")
+	}
+}
+
+func TestStreamMultipartPartsConflict(t *testing.T) {
+	const boundary = "X-TEST-BOUNDARY"
+	raw := "" +
+		"--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="file"; filename="hello.txt"` + "\r\n" +
+		"\r\n" +
+		"new content" + "\r\n" +
+		"--" + boundary + "--\r\n"
+
+	wfs := newFakeWriteFS()
+	wfs.files["/up/hello.txt"] = []byte("old content")
+
+	body := bufio.NewReader(strings.NewReader(raw))
+	_, err := streamMultipartParts(body, boundary, wfs, "/up", false)
+	if !errors.Is(err, errUploadConflict) {
+		t.Fatalf("err = %v; want errUploadConflict", err)
+	}
+	if string(wfs.files["/up/hello.txt"]) != "old content" {
+		t.Fatalf("existing file should be left untouched on conflict")
+	}
+}
+
+func TestStreamMultipartPartsMultipleParts(t *testing.T) {
+	const boundary = "X-TEST-BOUNDARY"
+	raw := "" +
+		"--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="notes"` + "\r\n" +
+		"\r\n" +
+		"just a form field, no filename" + "\r\n" +
+		"--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="file"; filename="a.txt"` + "\r\n" +
+		"\r\n" +
+		"AAA" + "\r\n" +
+		"--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="file2"; filename="b.txt"` + "\r\n" +
+		"\r\n" +
+		"BBB" + "\r\n" +
+		"--" + boundary + "--\r\n"
+
+	wfs := newFakeWriteFS()
+	body := bufio.NewReader(strings.NewReader(raw))
+	location, err := streamMultipartParts(body, boundary, wfs, "/up", false)
+	if err != nil {
+		t.Fatalf("streamMultipartParts 返回错误: %v", err)
+	}
+	if location != "/up/b.txt" {
+		t.Fatalf("location = %q; want last uploaded file /up/b.txt", location)
+	}
+	if string(wfs.files["/up/a.txt"]) != "AAA" || string(wfs.files["/up/b.txt"]) != "BBB" {
+		t.Fatalf("unexpected file contents: %v", wfs.files)
+	}
+	if _, ok := wfs.files["/up/notes"]; ok {
+		t.Fatalf("form field without filename should not be written as a file")
+	}
+}
+
+// TestStreamMultipartPartsBinaryWithoutNewlines 重现复查中指出的 bug：
+// 一个分段如果连续几十 KB 都不出现 0x0A，按行读取的实现会在写出前把它整个攒进内存，
+// 这里用一段没有任何换行符的大体积"二进制"数据确认新的按块扫描实现能正确流式写出
+func TestStreamMultipartPartsBinaryWithoutNewlines(t *testing.T) {
+	const boundary = "X-TEST-BOUNDARY"
+
+	binary := bytes.Repeat([]byte{0x00, 0x01, 0xFF, 0xFE}, 64*1024) // 256 KiB，不含 0x0A
+	var raw bytes.Buffer
+	raw.WriteString("--" + boundary + "\r\n")
+	raw.WriteString(`Content-Disposition: form-data; name="file"; filename="blob.bin"` + "\r\n")
+	raw.WriteString("Content-Type: application/octet-stream\r\n\r\n")
+	raw.Write(binary)
+	raw.WriteString("\r\n--" + boundary + "--\r\n")
+
+	wfs := newFakeWriteFS()
+	body := bufio.NewReader(&raw)
+	location, err := streamMultipartParts(body, boundary, wfs, "/up", false)
+	if err != nil {
+		t.Fatalf("streamMultipartParts 返回错误: %v", err)
+	}
+	if location != "/up/blob.bin" {
+		t.Fatalf("location = %q; want /up/blob.bin", location)
+	}
+	if got := wfs.files["/up/blob.bin"]; !bytes.Equal(got, binary) {
+		t.Fatalf("写入的二进制内容不匹配 (长度 got=%d want=%d)", len(got), len(binary))
+	}
+}
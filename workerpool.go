@@ -0,0 +1,24 @@
+package main
+
+// rangeWorkerPool 限制同时进行的 Range 读取/发送操作数量，
+// 避免一个客户端用大量并发分段请求打同一个大文件时把磁盘 I/O 或连接数打满
+type rangeWorkerPool struct {
+	sem chan struct{}
+}
+
+func newRangeWorkerPool(size int) *rangeWorkerPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &rangeWorkerPool{sem: make(chan struct{}, size)}
+}
+
+// run 占用一个工作槽位执行 job，阻塞直到有空闲槽位为止
+func (p *rangeWorkerPool) run(job func() error) error {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+	return job()
+}
+
+// rangeWorkers 是全局共享的 Range 读取工作池
+var rangeWorkers = newRangeWorkerPool(32)